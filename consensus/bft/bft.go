@@ -0,0 +1,405 @@
+// Package bft implements a pluggable, two-phase (prepare/commit) BFT-style
+// voting protocol used to gate ScheduleTask proposals: the task Owner acts
+// as coordinator, collects signed votes from the other participating
+// organizations (Partners, PowerSuppliers, Receivers) and only schedules
+// the task once >= 2/3 of the weighted participants have committed.
+package bft
+
+import (
+	"sync"
+	"time"
+
+	"github.com/RosettaFlow/Carrier-Go/common"
+	"github.com/RosettaFlow/Carrier-Go/types"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("module", "consensus/bft")
+
+var (
+	// ErrUnknownProposal is returned when a vote references a proposal the
+	// engine has no in-flight instance for.
+	ErrUnknownProposal = errors.New("bft: unknown proposal")
+	// ErrStaleView is returned when a vote or view-change references a view
+	// other than the instance's current view.
+	ErrStaleView = errors.New("bft: stale view")
+	// ErrReplayedVote is returned when the same (ProposalId, View, NodeId)
+	// vote has already been recorded for this phase.
+	ErrReplayedVote = errors.New("bft: replayed vote")
+	// ErrQuorumTimeout is returned when an instance's phase timeout elapses
+	// without reaching quorum.
+	ErrQuorumTimeout = errors.New("bft: quorum not reached before timeout")
+	// ErrDigestMismatch is returned when a vote endorses a digest other
+	// than the one the instance was proposed with.
+	ErrDigestMismatch = errors.New("bft: vote digest does not match proposal")
+	// ErrWrongPhase is returned when a commit vote arrives before the
+	// instance has reached PhaseCommit.
+	ErrWrongPhase = errors.New("bft: instance not in commit phase")
+)
+
+// Verifier authenticates vote signatures and resolves participant weights.
+// It is supplied by the caller so the engine stays decoupled from the
+// concrete identity/crypto implementation used by the node.
+type Verifier interface {
+	// Verify reports whether sig is a valid signature by nodeId over payload.
+	Verify(nodeId string, payload, sig []byte) bool
+	// Weight returns the voting weight assigned to nodeId within a
+	// proposal's participant set (owner, partners, power suppliers,
+	// receivers); participants not found in the set have weight 0.
+	Weight(proposalId common.Hash, nodeId string) uint64
+	// TotalWeight returns the sum of weights of all participants eligible
+	// to vote on proposalId.
+	TotalWeight(proposalId common.Hash) uint64
+}
+
+// Config tunes a single consensus Engine.
+type Config struct {
+	// PhaseTimeout bounds how long an instance waits in PhasePrepare or
+	// PhaseCommit before issuing a ViewChange.
+	PhaseTimeout time.Duration
+}
+
+var DefaultConfig = Config{
+	PhaseTimeout: 10 * time.Second,
+}
+
+// instance tracks the in-flight state of one proposal's consensus round.
+type instance struct {
+	mu sync.Mutex
+
+	proposalId common.Hash
+	digest     common.Hash
+	view       uint64
+	phase      types.TaskConsStatus
+
+	prepareVotes map[string]*PrepareVote
+	commitVotes  map[string]*CommitVote
+	dissenters   map[string]struct{}
+
+	resultCh  chan<- *types.TaskConsResult
+	timer     *time.Timer
+	finalized bool
+}
+
+// Engine coordinates BFT instances for proposals owned by this node. It is
+// safe for concurrent use.
+type Engine struct {
+	cfg      Config
+	verifier Verifier
+	wal      WAL
+
+	mu        sync.Mutex
+	instances map[common.Hash]*instance
+}
+
+// NewEngine builds an Engine backed by the given Verifier and WAL. Passing
+// a nil WAL disables crash-resume support.
+func NewEngine(cfg Config, verifier Verifier, wal WAL) *Engine {
+	if wal == nil {
+		wal = noopWAL{}
+	}
+	return &Engine{
+		cfg:       cfg,
+		verifier:  verifier,
+		wal:       wal,
+		instances: make(map[common.Hash]*instance),
+	}
+}
+
+// Propose starts a new consensus instance for the given proposal, beginning
+// at PhasePrepare, view 0 (or the view recovered from the WAL, if any).
+func (e *Engine) Propose(proposalId, digest common.Hash, resultCh chan<- *types.TaskConsResult) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.instances[proposalId]; ok {
+		return errors.Errorf("bft: proposal %s already has an in-flight instance", proposalId.Hex())
+	}
+
+	inst := &instance{
+		proposalId:   proposalId,
+		digest:       digest,
+		phase:        types.PhasePrepare,
+		prepareVotes: make(map[string]*PrepareVote),
+		commitVotes:  make(map[string]*CommitVote),
+		dissenters:   make(map[string]struct{}),
+		resultCh:     resultCh,
+	}
+	e.resumeFromWAL(inst)
+
+	e.instances[proposalId] = inst
+	e.wal.Append(WALRecord{ProposalId: proposalId, View: inst.view, Phase: inst.phase})
+
+	e.armTimeout(inst)
+	return nil
+}
+
+// resumeFromWAL replays any WAL records for inst.proposalId, rebuilding the
+// view, phase and vote sets a previous run of this node had reached for the
+// same view, so a restart picks up where it left off instead of
+// re-litigating votes that already landed. It is a no-op for a proposal the
+// WAL has never seen.
+func (e *Engine) resumeFromWAL(inst *instance) {
+	rec, ok := e.wal.Load(inst.proposalId)
+	if !ok {
+		return
+	}
+	inst.view = rec.View
+	inst.phase = rec.Phase
+
+	for _, r := range e.wal.Records(inst.proposalId) {
+		if r.NodeId == "" || r.View != inst.view {
+			continue
+		}
+		switch r.Phase {
+		case types.PhasePrepare:
+			inst.prepareVotes[r.NodeId] = &PrepareVote{ProposalId: r.ProposalId, View: r.View, Digest: r.Digest, NodeId: r.NodeId, Signature: r.Signature}
+		case types.PhaseCommit:
+			inst.commitVotes[r.NodeId] = &CommitVote{ProposalId: r.ProposalId, View: r.View, Digest: r.Digest, NodeId: r.NodeId, Signature: r.Signature}
+		case types.PhaseViewChange:
+			inst.dissenters[r.NodeId] = struct{}{}
+		}
+	}
+}
+
+// OnPrepareVote records an incoming PrepareVote and, once quorum is
+// reached, advances the instance to PhaseCommit.
+func (e *Engine) OnPrepareVote(vote *PrepareVote) error {
+	inst, err := e.lookup(vote.ProposalId)
+	if err != nil {
+		return err
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	if vote.View != inst.view {
+		return ErrStaleView
+	}
+	if vote.Digest != inst.digest {
+		return ErrDigestMismatch
+	}
+	if _, dup := inst.prepareVotes[vote.NodeId]; dup {
+		return ErrReplayedVote
+	}
+	if !e.verifier.Verify(vote.NodeId, SignedPayload(vote.ProposalId, vote.View, PhasePrepare, vote.Digest), vote.Signature) {
+		return errors.Errorf("bft: invalid prepare signature from %s", vote.NodeId)
+	}
+
+	inst.prepareVotes[vote.NodeId] = vote
+	e.wal.Append(WALRecord{ProposalId: vote.ProposalId, View: vote.View, Phase: types.PhasePrepare, NodeId: vote.NodeId, Digest: vote.Digest, Signature: vote.Signature})
+
+	if inst.phase == types.PhasePrepare && e.hasQuorum(inst, inst.prepareVotes) {
+		inst.phase = types.PhaseCommit
+		e.armTimeoutLocked(inst)
+	}
+	return nil
+}
+
+// OnCommitVote records an incoming CommitVote and, once quorum is reached,
+// finalizes the instance and publishes the aggregated result.
+func (e *Engine) OnCommitVote(vote *CommitVote) error {
+	inst, err := e.lookup(vote.ProposalId)
+	if err != nil {
+		return err
+	}
+
+	inst.mu.Lock()
+	if vote.View != inst.view {
+		inst.mu.Unlock()
+		return ErrStaleView
+	}
+	if inst.phase != types.PhaseCommit {
+		inst.mu.Unlock()
+		return ErrWrongPhase
+	}
+	if vote.Digest != inst.digest {
+		inst.mu.Unlock()
+		return ErrDigestMismatch
+	}
+	if _, dup := inst.commitVotes[vote.NodeId]; dup {
+		inst.mu.Unlock()
+		return ErrReplayedVote
+	}
+	if !e.verifier.Verify(vote.NodeId, SignedPayload(vote.ProposalId, vote.View, PhaseCommit, vote.Digest), vote.Signature) {
+		inst.mu.Unlock()
+		return errors.Errorf("bft: invalid commit signature from %s", vote.NodeId)
+	}
+
+	inst.commitVotes[vote.NodeId] = vote
+	e.wal.Append(WALRecord{ProposalId: vote.ProposalId, View: vote.View, Phase: types.PhaseCommit, NodeId: vote.NodeId, Digest: vote.Digest, Signature: vote.Signature})
+
+	reachedQuorum := e.hasCommitQuorum(inst, inst.commitVotes)
+	if reachedQuorum {
+		if inst.timer != nil {
+			inst.timer.Stop()
+		}
+	}
+	inst.mu.Unlock()
+
+	if reachedQuorum {
+		e.finalize(inst, nil)
+	}
+	return nil
+}
+
+// OnViewChange records a ViewChange request; once >= 2/3 of weight has
+// requested a change the instance moves to View+1 and restarts at
+// PhasePrepare.
+func (e *Engine) OnViewChange(vc *ViewChange) error {
+	inst, err := e.lookup(vc.ProposalId)
+	if err != nil {
+		return err
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	if vc.View != inst.view {
+		return ErrStaleView
+	}
+	inst.dissenters[vc.NodeId] = struct{}{}
+	e.wal.Append(WALRecord{ProposalId: vc.ProposalId, View: vc.View, Phase: types.PhaseViewChange, NodeId: vc.NodeId, Signature: vc.Signature})
+
+	if e.hasQuorumCount(inst, inst.dissenters) {
+		inst.view++
+		inst.phase = types.PhasePrepare
+		inst.prepareVotes = make(map[string]*PrepareVote)
+		inst.commitVotes = make(map[string]*CommitVote)
+		inst.dissenters = make(map[string]struct{})
+		e.armTimeoutLocked(inst)
+	}
+	return nil
+}
+
+func (e *Engine) lookup(proposalId common.Hash) (*instance, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	inst, ok := e.instances[proposalId]
+	if !ok {
+		return nil, ErrUnknownProposal
+	}
+	return inst, nil
+}
+
+// hasQuorumWeight reports whether the combined weight of voterIds is at
+// least 2/3 of the proposal's total participant weight.
+func (e *Engine) hasQuorumWeight(proposalId common.Hash, voterIds []string) bool {
+	var weight uint64
+	for _, id := range voterIds {
+		weight += e.verifier.Weight(proposalId, id)
+	}
+	total := e.verifier.TotalWeight(proposalId)
+	return total > 0 && weight*3 >= total*2
+}
+
+func (e *Engine) hasQuorum(inst *instance, prepareVotes map[string]*PrepareVote) bool {
+	ids := make([]string, 0, len(prepareVotes))
+	for id := range prepareVotes {
+		ids = append(ids, id)
+	}
+	return e.hasQuorumWeight(inst.proposalId, ids)
+}
+
+func (e *Engine) hasCommitQuorum(inst *instance, commitVotes map[string]*CommitVote) bool {
+	ids := make([]string, 0, len(commitVotes))
+	for id := range commitVotes {
+		ids = append(ids, id)
+	}
+	return e.hasQuorumWeight(inst.proposalId, ids)
+}
+
+func (e *Engine) hasQuorumCount(inst *instance, dissenters map[string]struct{}) bool {
+	ids := make([]string, 0, len(dissenters))
+	for id := range dissenters {
+		ids = append(ids, id)
+	}
+	return e.hasQuorumWeight(inst.proposalId, ids)
+}
+
+func (e *Engine) armTimeout(inst *instance) {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	e.armTimeoutLocked(inst)
+}
+
+// armTimeoutLocked must be called with inst.mu held.
+func (e *Engine) armTimeoutLocked(inst *instance) {
+	if inst.timer != nil {
+		inst.timer.Stop()
+	}
+	phase, view := inst.phase, inst.view
+	inst.timer = time.AfterFunc(e.cfg.PhaseTimeout, func() {
+		e.onTimeout(inst, phase, view)
+	})
+}
+
+// onTimeout fires when an instance spends longer than PhaseTimeout in the
+// phase/view it was armed for. Rather than giving up on the proposal, it
+// issues a ViewChange: the view is bumped, the phase resets to
+// PhasePrepare and every vote/dissenter tally is cleared, same as the
+// quorum-reached branch of OnViewChange, so the participants get another
+// round instead of the instance being torn down.
+func (e *Engine) onTimeout(inst *instance, phase types.TaskConsStatus, view uint64) {
+	inst.mu.Lock()
+	if inst.phase != phase || inst.view != view {
+		// Already advanced past this phase/view; stale timer fired.
+		inst.mu.Unlock()
+		return
+	}
+	inst.view++
+	inst.phase = types.PhasePrepare
+	inst.prepareVotes = make(map[string]*PrepareVote)
+	inst.commitVotes = make(map[string]*CommitVote)
+	inst.dissenters = make(map[string]struct{})
+	e.armTimeoutLocked(inst)
+	inst.mu.Unlock()
+
+	log.Warnf("bft: proposal %s timed out in phase %v at view %d, requesting view change", inst.proposalId.Hex(), phase, view)
+	e.wal.Append(WALRecord{ProposalId: inst.proposalId, View: view, Phase: types.PhaseViewChange})
+}
+
+// finalize removes the instance and publishes its TaskConsResult. It is
+// idempotent: two OnCommitVote calls racing past the commit quorum can
+// both attempt to finalize the same instance, and only the first must
+// actually send on resultCh, since a second send would either duplicate
+// the result or block forever on a channel nobody reads any more.
+func (e *Engine) finalize(inst *instance, failErr error) {
+	inst.mu.Lock()
+	if inst.finalized {
+		inst.mu.Unlock()
+		return
+	}
+	inst.finalized = true
+	inst.mu.Unlock()
+
+	e.mu.Lock()
+	delete(e.instances, inst.proposalId)
+	e.mu.Unlock()
+
+	inst.mu.Lock()
+	votes := make([]*types.ConsVote, 0, len(inst.commitVotes))
+	for _, v := range inst.commitVotes {
+		votes = append(votes, &types.ConsVote{NodeId: v.NodeId, Digest: v.Digest, Signature: v.Signature})
+	}
+	dissenters := make([]string, 0, len(inst.dissenters))
+	for id := range inst.dissenters {
+		dissenters = append(dissenters, id)
+	}
+	view := inst.view
+	resultCh := inst.resultCh
+	inst.mu.Unlock()
+
+	if resultCh == nil {
+		return
+	}
+	resultCh <- &types.TaskConsResult{
+		Status:     types.PhaseCommit,
+		Done:       failErr == nil,
+		Err:        failErr,
+		View:       view,
+		Votes:      votes,
+		Dissenters: dissenters,
+	}
+}
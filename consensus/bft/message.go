@@ -0,0 +1,79 @@
+package bft
+
+import (
+	"github.com/RosettaFlow/Carrier-Go/common"
+)
+
+// Phase identifies which round of the two-phase protocol a message belongs to.
+type Phase uint8
+
+const (
+	PhasePrepare Phase = iota
+	PhaseCommit
+	PhaseViewChange
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhasePrepare:
+		return "prepare"
+	case PhaseCommit:
+		return "commit"
+	case PhaseViewChange:
+		return "view-change"
+	default:
+		return "unknown"
+	}
+}
+
+// PrepareVote is broadcast by a participant once it has validated a
+// proposed ScheduleTask and is willing to endorse it for the given view.
+type PrepareVote struct {
+	ProposalId common.Hash
+	View       uint64
+	Digest     common.Hash
+	NodeId     string
+	Signature  []byte
+}
+
+// CommitVote is broadcast by a participant once it has observed >= 2/3 of
+// the weighted PrepareVotes for a (ProposalId, View, Digest).
+type CommitVote struct {
+	ProposalId common.Hash
+	View       uint64
+	Digest     common.Hash
+	NodeId     string
+	Signature  []byte
+}
+
+// ViewChange is broadcast by a participant when the current view's timeout
+// elapses without reaching commit quorum, requesting the coordinator move
+// on to View+1.
+type ViewChange struct {
+	ProposalId common.Hash
+	View       uint64
+	NodeId     string
+	Reason     string
+	Signature  []byte
+}
+
+// SignedPayload returns the byte sequence that NodeId is expected to have
+// signed with its identity key for a PrepareVote or CommitVote: the
+// concatenation of ProposalId, View (8 bytes, little-endian), Phase and
+// the proposal Digest.
+func SignedPayload(proposalId common.Hash, view uint64, phase Phase, digest common.Hash) []byte {
+	buf := make([]byte, 0, len(proposalId)+8+1+len(digest))
+	buf = append(buf, proposalId.Bytes()...)
+	buf = append(buf, uint64ToBytes(view)...)
+	buf = append(buf, byte(phase))
+	buf = append(buf, digest.Bytes()...)
+	return buf
+}
+
+func uint64ToBytes(v uint64) []byte {
+	b := make([]byte, 8)
+	for i := 0; i < 8; i++ {
+		b[i] = byte(v >> (8 * uint(i)))
+	}
+	return b
+}
@@ -0,0 +1,132 @@
+package bft
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/RosettaFlow/Carrier-Go/common"
+	"github.com/RosettaFlow/Carrier-Go/types"
+)
+
+// WALRecord is one entry appended to the write-ahead log. A record with no
+// NodeId marks a (View, Phase) transition for the proposal as a whole; a
+// record with a NodeId is an individual vote or view-change, carrying
+// enough of the original message (Digest, Signature) to be replayed back
+// into an instance's vote maps verbatim, without needing the voter to
+// resend it.
+type WALRecord struct {
+	ProposalId common.Hash
+	View       uint64
+	Phase      types.TaskConsStatus
+	NodeId     string
+	Digest     common.Hash
+	Signature  []byte
+}
+
+// WAL persists consensus progress so a restarted node can resume an
+// in-flight instance instead of replaying it from view 0.
+type WAL interface {
+	Append(rec WALRecord)
+	// Load returns the most recently appended record for proposalId, if
+	// any; that may be a (View, Phase) transition or an individual vote.
+	Load(proposalId common.Hash) (WALRecord, bool)
+	// Records returns every record appended for proposalId, in append
+	// order, so a resuming instance can rebuild its vote maps rather than
+	// just its (View, Phase).
+	Records(proposalId common.Hash) []WALRecord
+}
+
+type noopWAL struct{}
+
+func (noopWAL) Append(WALRecord)                   {}
+func (noopWAL) Load(common.Hash) (WALRecord, bool) { return WALRecord{}, false }
+func (noopWAL) Records(common.Hash) []WALRecord    { return nil }
+
+// fileWAL is a minimal append-only, newline-delimited JSON WAL backed by a
+// single file. It keeps every record per proposal in memory so Load and
+// Records do not need to re-scan the file.
+type fileWAL struct {
+	mu      sync.Mutex
+	file    *os.File
+	latest  map[common.Hash]WALRecord
+	records map[common.Hash][]WALRecord
+}
+
+// OpenFileWAL opens (creating if necessary) the WAL file at path and
+// replays it to rebuild the in-memory indexes.
+func OpenFileWAL(path string) (WAL, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := &fileWAL{
+		file:    f,
+		latest:  make(map[common.Hash]WALRecord),
+		records: make(map[common.Hash][]WALRecord),
+	}
+	if err := w.replay(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *fileWAL) replay() error {
+	if _, err := w.file.Seek(0, 0); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(w.file)
+	for scanner.Scan() {
+		var rec WALRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// A torn final write from a previous crash; stop replay here
+			// rather than failing startup.
+			break
+		}
+		w.index(rec)
+	}
+	if _, err := w.file.Seek(0, 2); err != nil {
+		return err
+	}
+	return scanner.Err()
+}
+
+// index must be called with w.mu held (or during single-threaded replay).
+func (w *fileWAL) index(rec WALRecord) {
+	w.latest[rec.ProposalId] = rec
+	w.records[rec.ProposalId] = append(w.records[rec.ProposalId], rec)
+}
+
+func (w *fileWAL) Append(rec WALRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.index(rec)
+	data, err := json.Marshal(rec)
+	if err != nil {
+		log.Errorf("bft: failed to marshal WAL record: %v", err)
+		return
+	}
+	data = append(data, '\n')
+	if _, err := w.file.Write(data); err != nil {
+		log.Errorf("bft: failed to append WAL record: %v", err)
+	}
+}
+
+func (w *fileWAL) Load(proposalId common.Hash) (WALRecord, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	rec, ok := w.latest[proposalId]
+	return rec, ok
+}
+
+func (w *fileWAL) Records(proposalId common.Hash) []WALRecord {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	recs := w.records[proposalId]
+	out := make([]WALRecord, len(recs))
+	copy(out, recs)
+	return out
+}
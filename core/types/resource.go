@@ -2,18 +2,36 @@ package types
 
 import (
 	"bytes"
-	"github.com/RosettaFlow/Carrier-Go/common"
-	libTypes "github.com/RosettaFlow/Carrier-Go/lib/types"
+	"hash/crc32"
 	"io"
+	"sync"
 	"sync/atomic"
+
+	"github.com/RosettaFlow/Carrier-Go/common"
+	libTypes "github.com/RosettaFlow/Carrier-Go/lib/types"
 )
 
+// castagnoliTable is the CRC-32C (Castagnoli) polynomial table used to
+// cheaply detect corruption in cached-and-replayed Resource blobs without
+// having to re-unmarshal them.
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// resourceBufPool recycles the byte slices Hash passes to MarshalTo so
+// hashing a Resource set doesn't allocate a buffer on every call.
+var resourceBufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 256)
+		return &buf
+	},
+}
+
 type Resource struct {
 	data *libTypes.ResourceData
 
 	// caches
 	hash atomic.Value
 	size atomic.Value
+	crc  atomic.Value
 }
 
 func NewResource(data *libTypes.ResourceData) *Resource {
@@ -23,13 +41,39 @@ func NewResource(data *libTypes.ResourceData) *Resource {
 func (m *Resource) EncodePb(w io.Writer) error {
 	data, err := m.data.Marshal()
 	if err != nil {
-		w.Write(data)
+		return err
 	}
+	_, err = w.Write(data)
 	return err
 }
 
+// MarshalTo is a zero-copy-friendly fast path for EncodePb: it marshals
+// into buf, reusing its backing array when it is large enough, instead of
+// allocating a fresh buffer on every call. Like EncodePb, it defers to the
+// generated gogoproto code, which encodes scalar/message fields in a
+// fixed, field-number order with standard (minimal-length) varints; it
+// does not use fixed-width varints, and it is NOT guaranteed
+// deterministic for any field of map type ResourceData may gain in the
+// future, since Go randomizes map iteration order. Hash() and Verify()
+// are only as stable as this encoding is.
+func (m *Resource) MarshalTo(buf []byte) ([]byte, error) {
+	if m.data == nil {
+		m.data = new(libTypes.ResourceData)
+	}
+	size := m.data.Size()
+	if cap(buf) < size {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+	if _, err := m.data.MarshalTo(buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
 func (m *Resource) DecodePb(data []byte) error {
 	m.size.Store(common.StorageSize(len(data)))
+	m.crc.Store(crc32.Checksum(data, castagnoliTable))
 	return m.data.Unmarshal(data)
 }
 
@@ -37,13 +81,40 @@ func (m *Resource) Hash() common.Hash {
 	if hash := m.hash.Load(); hash != nil {
 		return hash.(common.Hash)
 	}
-	buffer := new(bytes.Buffer)
-	m.EncodePb(buffer)
-	v := protoBufHash(buffer.Bytes())
+
+	bufPtr := resourceBufPool.Get().(*[]byte)
+	defer resourceBufPool.Put(bufPtr)
+
+	data, err := m.MarshalTo((*bufPtr)[:0])
+	if err != nil {
+		buffer := new(bytes.Buffer)
+		m.EncodePb(buffer)
+		data = buffer.Bytes()
+	} else {
+		// Keep a slice MarshalTo had to grow so the next Hash reuses it.
+		*bufPtr = data[:0]
+	}
+
+	m.size.Store(common.StorageSize(len(data)))
+	m.crc.Store(crc32.Checksum(data, castagnoliTable))
+
+	v := protoBufHash(data)
 	m.hash.Store(v)
 	return v
 }
 
+// Verify reports whether data's CRC-32C matches the checksum cached the
+// last time this Resource was hashed or decoded, letting a peer that
+// receives a ResourceArray.GetPb(i) blob cheaply detect corruption without
+// re-unmarshalling it. It returns false if no checksum has been cached yet.
+func (m *Resource) Verify(data []byte) bool {
+	cached := m.crc.Load()
+	if cached == nil {
+		return false
+	}
+	return cached.(uint32) == crc32.Checksum(data, castagnoliTable)
+}
+
 // ResourceArray is a Transaction slice type for basic sorting.
 type ResourceArray []*Resource
 
@@ -73,4 +144,3 @@ func (s ResourceArray) To() []*libTypes.ResourceData {
 	}
 	return arr
 }
-
@@ -0,0 +1,52 @@
+package types
+
+import (
+	"testing"
+
+	libTypes "github.com/RosettaFlow/Carrier-Go/lib/types"
+)
+
+const benchResourceCount = 10000
+
+func benchResourceMetaData() []*libTypes.ResourceData {
+	metaData := make([]*libTypes.ResourceData, benchResourceCount)
+	for i := range metaData {
+		metaData[i] = new(libTypes.ResourceData)
+	}
+	return metaData
+}
+
+func newBenchResourceArray(metaData []*libTypes.ResourceData) ResourceArray {
+	resources := make(ResourceArray, len(metaData))
+	for i, v := range metaData {
+		resources[i] = NewResource(v)
+	}
+	return resources
+}
+
+// BenchmarkNewResourceArray measures allocations for building an N=10k
+// ResourceArray from metadata.
+func BenchmarkNewResourceArray(b *testing.B) {
+	metaData := benchResourceMetaData()
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = newBenchResourceArray(metaData)
+	}
+}
+
+// BenchmarkResourceArray_Hash measures allocations for building a fresh
+// N=10k ResourceArray and hashing every resource in it, exercising the
+// pooled MarshalTo fast path Hash() uses instead of allocating a
+// bytes.Buffer per call.
+func BenchmarkResourceArray_Hash(b *testing.B) {
+	metaData := benchResourceMetaData()
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		resources := newBenchResourceArray(metaData)
+		for _, resource := range resources {
+			_ = resource.Hash()
+		}
+	}
+}
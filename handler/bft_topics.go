@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"github.com/RosettaFlow/Carrier-Go/consensus/bft"
+	"github.com/RosettaFlow/Carrier-Go/p2p"
+	"github.com/libp2p/go-libp2p-core/network"
+)
+
+// RPC topics carrying the BFT prepare/commit/view-change messages defined
+// in consensus/bft, alongside the existing by-range and status/ping topics
+// handled by this package.
+const (
+	BFTPrepareVoteTopic = "/bft/prepare_vote"
+	BFTCommitVoteTopic  = "/bft/commit_vote"
+	BFTViewChangeTopic  = "/bft/view_change"
+)
+
+// bftGossipHandlers wires the BFT topics to an Engine so incoming votes and
+// view-changes from peers are decoded off the stream and fed into the
+// running consensus instances.
+type bftGossipHandlers struct {
+	p2p    p2p.P2P
+	engine *bft.Engine
+}
+
+func newBFTGossipHandlers(p2pProvider p2p.P2P, engine *bft.Engine) *bftGossipHandlers {
+	return &bftGossipHandlers{p2p: p2pProvider, engine: engine}
+}
+
+func (h *bftGossipHandlers) onPrepareVote(stream network.Stream) error {
+	vote := new(bft.PrepareVote)
+	if err := h.p2p.Encoding().DecodeWithMaxLength(stream, vote); err != nil {
+		return err
+	}
+	return h.engine.OnPrepareVote(vote)
+}
+
+func (h *bftGossipHandlers) onCommitVote(stream network.Stream) error {
+	vote := new(bft.CommitVote)
+	if err := h.p2p.Encoding().DecodeWithMaxLength(stream, vote); err != nil {
+		return err
+	}
+	return h.engine.OnCommitVote(vote)
+}
+
+func (h *bftGossipHandlers) onViewChange(stream network.Stream) error {
+	vc := new(bft.ViewChange)
+	if err := h.p2p.Encoding().DecodeWithMaxLength(stream, vc); err != nil {
+		return err
+	}
+	return h.engine.OnViewChange(vc)
+}
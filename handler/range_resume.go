@@ -0,0 +1,16 @@
+package handler
+
+import "strconv"
+
+// formatResumeToken and parseResumeToken encode/decode the index-based
+// resume token used by the by-range streaming responses. The token is
+// intentionally opaque to callers (a plain decimal index today), so the
+// encoding can change without breaking the RangeRequest/RangeResponse
+// contract.
+func formatResumeToken(idx int) string {
+	return strconv.Itoa(idx)
+}
+
+func parseResumeToken(token string) (int, error) {
+	return strconv.Atoi(token)
+}
@@ -0,0 +1,386 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"sync"
+
+	coretypes "github.com/RosettaFlow/Carrier-Go/core/types"
+	libTypes "github.com/RosettaFlow/Carrier-Go/lib/types"
+	"github.com/RosettaFlow/Carrier-Go/p2p"
+	"github.com/RosettaFlow/Carrier-Go/types"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/pkg/errors"
+)
+
+// Gossip/RPC topics for bulk, streamed range sync, alongside the existing
+// RPCBlocksByRangeTopic handled by this package. Registered against the
+// host, with their own rate-limiter collectors, by Service.Start.
+const (
+	RPCTasksByRangeTopic     = "/carrier/req/tasks_by_range"
+	RPCResourcesByRangeTopic = "/carrier/req/resources_by_range"
+)
+
+// maxRangeCount bounds how many items a single RangeRequest may ask for,
+// so a malicious or buggy peer can't force an unbounded stream.
+const maxRangeCount = 1000
+
+// rangeStreamBurst sizes the leaky bucket for the by-range topics by the
+// maximum number of frames a single request can produce.
+const rangeStreamBurst = maxRangeCount
+
+var (
+	// ErrRangeCountTooLarge is returned when a RangeRequest.Count is zero or
+	// exceeds maxRangeCount.
+	ErrRangeCountTooLarge = errors.New("handler: requested range count exceeds maximum")
+	// ErrRangeStepZero is returned when a RangeRequest.Step is zero, which
+	// would otherwise spin forever without advancing.
+	ErrRangeStepZero = errors.New("handler: range step must be >= 1")
+)
+
+// RangeRequest asks a peer for up to Count items starting at StartKey,
+// advancing Step items at a time, optionally narrowed by Filter. StartKey
+// is either the empty string (start from the beginning) or a ResumeToken
+// from a previous response, letting a dropped stream resume without
+// re-sending earlier frames. Filter, when non-empty, is matched as a raw
+// substring against each item's serialized bytes.
+type RangeRequest struct {
+	StartKey string
+	Count    uint64
+	Step     uint64
+	Filter   string
+}
+
+func (r *RangeRequest) validate() error {
+	if r.Count == 0 || r.Count > maxRangeCount {
+		return ErrRangeCountTooLarge
+	}
+	if r.Step == 0 {
+		return ErrRangeStepZero
+	}
+	return nil
+}
+
+// matchesFilter reports whether frame should be included in the range
+// response. An empty Filter matches everything; otherwise frame must
+// contain Filter as a raw substring of its serialized bytes, which works
+// uniformly across Task and Resource payloads without requiring
+// type-specific field accessors.
+func matchesFilter(frame []byte, filter string) bool {
+	if filter == "" {
+		return true
+	}
+	return bytes.Contains(frame, []byte(filter))
+}
+
+// Wire format for both by-range responses: a sequence of frames, each a
+// 1-byte type tag, a uint32 big-endian length, then that many bytes of
+// payload. frameTypeItem frames carry a serialized Task/Resource; a
+// response served in full ends with exactly one frameTypeResume frame
+// carrying the resume token, so the client can tell "more data" from
+// "done" without an out-of-band signal. A response cut short by an error
+// ends without a resume frame.
+const (
+	frameTypeItem   byte = 0
+	frameTypeResume byte = 1
+)
+
+func writeFrame(w io.Writer, frameType byte, data []byte) error {
+	var header [5]byte
+	header[0] = frameType
+	binary.BigEndian.PutUint32(header[1:], uint32(len(data)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readFrame reads one frame written by writeFrame, returning io.EOF once
+// the peer closes the stream cleanly between frames.
+func readFrame(r io.Reader) (frameType byte, data []byte, err error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	data = make([]byte, binary.BigEndian.Uint32(header[1:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	return header[0], data, nil
+}
+
+func writeLengthPrefixedFrame(w io.Writer, data []byte) error {
+	return writeFrame(w, frameTypeItem, data)
+}
+
+// writeResumeToken writes the single frameTypeResume frame that terminates
+// a by-range response.
+func writeResumeToken(w io.Writer, token string) error {
+	return writeFrame(w, frameTypeResume, []byte(token))
+}
+
+// readLengthPrefixedFrame reads the next frame and returns its payload. It
+// returns errResumeFrame (wrapping the resume token) when the frame is the
+// terminating frameTypeResume frame, so the caller can surface it instead
+// of mistaking it for another item.
+func readLengthPrefixedFrame(r io.Reader) ([]byte, error) {
+	frameType, data, err := readFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	if frameType == frameTypeResume {
+		return nil, &errResumeFrame{token: string(data)}
+	}
+	return data, nil
+}
+
+// errResumeFrame is not a real error: it is how readLengthPrefixedFrame
+// surfaces the terminating resume-token frame to its caller's read loop.
+type errResumeFrame struct{ token string }
+
+func (e *errResumeFrame) Error() string { return "range sync: resume frame" }
+
+// writeTasksByRange streams up to req.Count tasks from tasks, starting at
+// the index encoded in req.StartKey (or 0) and advancing req.Step at a
+// time, as length-prefixed TaskData frames, skipping any whose serialized
+// bytes don't match req.Filter. Each frame is charged against l's by-range
+// collector both as a unit count and by its serialized size, matching the
+// chunk/length cost model RPCBlocksByRangeTopic already uses so large
+// frames drain proportionally more of the peer's budget. The index just
+// past the last frame sent is returned as a resume token so a dropped
+// stream can continue without resending earlier items; it is the caller's
+// job to put it on the wire via writeResumeToken.
+func writeTasksByRange(l *limiter, stream network.Stream, tasks types.TaskDataArray, req *RangeRequest) (resumeToken string, err error) {
+	if err := req.validate(); err != nil {
+		return "", err
+	}
+	start, err := rangeStartIndex(req.StartKey, tasks.Len())
+	if err != nil {
+		return "", err
+	}
+
+	sent := uint64(0)
+	idx := start
+	for idx < tasks.Len() && sent < req.Count {
+		frame := tasks.GetPb(idx)
+		if !matchesFilter(frame, req.Filter) {
+			idx += int(req.Step)
+			continue
+		}
+		if err := l.validateSizedRequest(stream, 1, uint64(len(frame))); err != nil {
+			return "", err
+		}
+		if err := writeLengthPrefixedFrame(stream, frame); err != nil {
+			return "", err
+		}
+		l.addSized(stream, 1, int64(len(frame)))
+		sent++
+		idx += int(req.Step)
+	}
+	return rangeResumeToken(idx), nil
+}
+
+// writeResourcesByRange is writeTasksByRange's counterpart for ResourceArray.
+func writeResourcesByRange(l *limiter, stream network.Stream, resources coretypes.ResourceArray, req *RangeRequest) (resumeToken string, err error) {
+	if err := req.validate(); err != nil {
+		return "", err
+	}
+	start, err := rangeStartIndex(req.StartKey, resources.Len())
+	if err != nil {
+		return "", err
+	}
+
+	sent := uint64(0)
+	idx := start
+	for idx < resources.Len() && sent < req.Count {
+		frame := resources.GetPb(idx)
+		if !matchesFilter(frame, req.Filter) {
+			idx += int(req.Step)
+			continue
+		}
+		if err := l.validateSizedRequest(stream, 1, uint64(len(frame))); err != nil {
+			return "", err
+		}
+		if err := writeLengthPrefixedFrame(stream, frame); err != nil {
+			return "", err
+		}
+		l.addSized(stream, 1, int64(len(frame)))
+		sent++
+		idx += int(req.Step)
+	}
+	return rangeResumeToken(idx), nil
+}
+
+// readRangeRequest decodes, via p2pProvider's configured encoding, the
+// RangeRequest a client wrote as the opening message of a by-range stream.
+func readRangeRequest(p2pProvider p2p.P2P, stream network.Stream) (*RangeRequest, error) {
+	req := new(RangeRequest)
+	if err := p2pProvider.Encoding().DecodeWithMaxLength(stream, req); err != nil {
+		return nil, err
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// TaskRangeStream is the client-side handle for an in-flight
+// RequestTasksByRange call: Items yields decoded tasks as they arrive, and
+// ResumeToken blocks until the stream ends (or ctx is canceled) and
+// returns the token to pass as the next RangeRequest.StartKey.
+type TaskRangeStream struct {
+	Items <-chan *types.Task
+
+	mu          sync.Mutex
+	resumeToken string
+	done        chan struct{}
+}
+
+// ResumeToken blocks until the underlying stream has finished draining and
+// returns the resume token for continuing this range from where it left
+// off. It returns "" if the stream ended without one (e.g. on error).
+func (s *TaskRangeStream) ResumeToken() string {
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resumeToken
+}
+
+// ResourceRangeStream is TaskRangeStream's counterpart for resources.
+type ResourceRangeStream struct {
+	Items <-chan *coretypes.Resource
+
+	mu          sync.Mutex
+	resumeToken string
+	done        chan struct{}
+}
+
+// ResumeToken is TaskRangeStream.ResumeToken's counterpart.
+func (s *ResourceRangeStream) ResumeToken() string {
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resumeToken
+}
+
+// RequestTasksByRange opens a by-range stream to peer and decodes the
+// response into a TaskRangeStream, closing its Items channel once the
+// stream ends or ctx is canceled. The caller must drain Items (or cancel
+// ctx) to avoid leaking the underlying goroutine, and should call
+// ResumeToken afterwards if it may need to continue the range later.
+func RequestTasksByRange(ctx context.Context, h p2p.P2P, pid peer.ID, req *RangeRequest) (*TaskRangeStream, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	stream, err := openRangeStream(ctx, h, pid, RPCTasksByRangeTopic, req)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *types.Task)
+	rs := &TaskRangeStream{Items: out, done: make(chan struct{})}
+	go func() {
+		defer close(out)
+		defer close(rs.done)
+		defer stream.Close()
+		for {
+			data, err := readLengthPrefixedFrame(stream)
+			if err != nil {
+				if rf, ok := err.(*errResumeFrame); ok {
+					rs.mu.Lock()
+					rs.resumeToken = rf.token
+					rs.mu.Unlock()
+				}
+				return
+			}
+			task := types.NewTask(new(libTypes.TaskData))
+			if err := task.DecodePb(data); err != nil {
+				log.Errorf("range sync: failed to decode task frame from %s: %v", pid, err)
+				return
+			}
+			select {
+			case out <- task:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return rs, nil
+}
+
+// RequestResourcesByRange is RequestTasksByRange's counterpart for
+// *coretypes.Resource.
+func RequestResourcesByRange(ctx context.Context, h p2p.P2P, pid peer.ID, req *RangeRequest) (*ResourceRangeStream, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	stream, err := openRangeStream(ctx, h, pid, RPCResourcesByRangeTopic, req)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *coretypes.Resource)
+	rs := &ResourceRangeStream{Items: out, done: make(chan struct{})}
+	go func() {
+		defer close(out)
+		defer close(rs.done)
+		defer stream.Close()
+		for {
+			data, err := readLengthPrefixedFrame(stream)
+			if err != nil {
+				if rf, ok := err.(*errResumeFrame); ok {
+					rs.mu.Lock()
+					rs.resumeToken = rf.token
+					rs.mu.Unlock()
+				}
+				return
+			}
+			resource := coretypes.NewResource(new(libTypes.ResourceData))
+			if err := resource.DecodePb(data); err != nil {
+				log.Errorf("range sync: failed to decode resource frame from %s: %v", pid, err)
+				return
+			}
+			select {
+			case out <- resource:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return rs, nil
+}
+
+// openRangeStream opens a new stream to pid on topic and writes req as the
+// opening message; the caller owns the returned stream.
+func openRangeStream(ctx context.Context, h p2p.P2P, pid peer.ID, topic string, req *RangeRequest) (network.Stream, error) {
+	stream, err := h.Send(ctx, req, topic, pid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "range sync: failed to open %s stream to %s", topic, pid)
+	}
+	return stream, nil
+}
+
+// rangeStartIndex decodes a resume token (produced by rangeResumeToken)
+// back into a slice index, clamping to length so a stale token from a
+// shrunk collection doesn't panic.
+func rangeStartIndex(token string, length int) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	idx, err := parseResumeToken(token)
+	if err != nil {
+		return 0, errors.Wrap(err, "handler: invalid resume token")
+	}
+	if idx > length {
+		idx = length
+	}
+	return idx, nil
+}
+
+func rangeResumeToken(idx int) string {
+	return formatResumeToken(idx)
+}
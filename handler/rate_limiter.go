@@ -1,24 +1,30 @@
 package handler
 
 import (
+	"reflect"
+	"sync"
+	"time"
+
 	"github.com/RosettaFlow/Carrier-Go/p2p"
-	p2ptypes "github.com/RosettaFlow/Carrier-Go/p2p/types"
-	"github.com/kevinms/leakybucket-go"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/trailofbits/go-mutexasserts"
-	"reflect"
-	"sync"
 )
 
+var log = logrus.WithField("module", "handler")
+
 const defaultBurstLimit = 5
 
 // Dummy topic to validate all incoming rpc requests.
 const rpcLimiterTopic = "rpc-limiter-topic"
 
+// retryAfterWindow approximates how long a peer should wait before a
+// bucket it just emptied will have leaked enough to admit another request.
+const retryAfterWindow = time.Second
+
 type limiter struct {
-	limiterMap map[string]*leakybucket.Collector
+	limiterMap map[string]*scoredCollector
 	p2p        p2p.P2P
 	sync.RWMutex
 }
@@ -31,38 +37,66 @@ func newRateLimiter(p2pProvider p2p.P2P) *limiter {
 		return topic + p2pProvider.Encoding().ProtocolSuffix()
 	}
 
+	bad := p2pProvider.Peers().Scorers().BadResponsesScorer()
+	good := lookupGoodResponsesScorer(p2pProvider)
+
+	newCollector := func(topic string, policy RatePolicy) *scoredCollector {
+		return newScoredCollector(topic, policy, bad, good)
+	}
+
 	// Set topic map for all rpc topics.
-	topicMap := make(map[string]*leakybucket.Collector, len(p2p.RPCTopicMappings))
+	topicMap := make(map[string]*scoredCollector, len(p2p.RPCTopicMappings))
 	// Goodbye Message
-	topicMap[addEncoding(p2p.RPCGoodByeTopic)] = leakybucket.NewCollector(1, 1, false /* deleteEmptyBuckets */)
+	topicMap[addEncoding(p2p.RPCGoodByeTopic)] = newCollector(p2p.RPCGoodByeTopic, RatePolicy{Rate: 1, Burst: 1, Alpha: 0, Min: 1, Max: 1})
 	// Metadata Message
-	topicMap[addEncoding(p2p.RPCMetaDataTopic)] = leakybucket.NewCollector(1, defaultBurstLimit, false /* deleteEmptyBuckets */)
+	topicMap[addEncoding(p2p.RPCMetaDataTopic)] = newCollector(p2p.RPCMetaDataTopic, RatePolicy{Rate: 1, Burst: defaultBurstLimit, Alpha: 0.5, Min: 0.2, Max: 2})
 	// Ping Message
-	topicMap[addEncoding(p2p.RPCPingTopic)] = leakybucket.NewCollector(1, defaultBurstLimit, false /* deleteEmptyBuckets */)
+	topicMap[addEncoding(p2p.RPCPingTopic)] = newCollector(p2p.RPCPingTopic, RatePolicy{Rate: 1, Burst: defaultBurstLimit, Alpha: 0.5, Min: 0.2, Max: 2})
 	// Status Message
-	topicMap[addEncoding(p2p.RPCStatusTopic)] = leakybucket.NewCollector(1, defaultBurstLimit, false /* deleteEmptyBuckets */)
-
-	// Use a single collector for block requests
-	blockCollector := leakybucket.NewCollector(1, defaultBurstLimit * 20, false /* deleteEmptyBuckets */)
+	topicMap[addEncoding(p2p.RPCStatusTopic)] = newCollector(p2p.RPCStatusTopic, RatePolicy{Rate: 1, Burst: defaultBurstLimit, Alpha: 0.5, Min: 0.2, Max: 2})
 
-	// BlockByRange requests
-	topicMap[addEncoding(p2p.RPCBlocksByRangeTopic)] = blockCollector
+	// BlockByRange requests: a single collector shared across the topic,
+	// sized well above the default burst and scaled more aggressively by
+	// reputation since a misbehaving peer here costs the most bandwidth.
+	topicMap[addEncoding(p2p.RPCBlocksByRangeTopic)] = newCollector(p2p.RPCBlocksByRangeTopic, RatePolicy{Rate: 1, Burst: defaultBurstLimit * 20, Alpha: 1, Min: 0.1, Max: 3})
 
 	// General topic for all rpc requests.
-	topicMap[rpcLimiterTopic] = leakybucket.NewCollector(5, defaultBurstLimit*2, false /* deleteEmptyBuckets */)
+	topicMap[rpcLimiterTopic] = newCollector(rpcLimiterTopic, RatePolicy{Rate: 5, Burst: defaultBurstLimit * 2, Alpha: 0.5, Min: 0.2, Max: 2})
 
 	return &limiter{limiterMap: topicMap, p2p: p2pProvider}
 }
 
+// SetPolicy replaces the RatePolicy for topic, rebuilding its underlying
+// buckets. Safe to call while the limiter is in use; in-flight buckets for
+// other topics are unaffected.
+func (l *limiter) SetPolicy(topic string, policy RatePolicy) error {
+	l.RLock()
+	collector, err := l.retrieveCollector(topic)
+	l.RUnlock()
+	if err != nil {
+		return err
+	}
+	collector.setPolicy(policy)
+	return nil
+}
+
 // Returns the current topic collector for the provided topic.
-func (l *limiter) topicCollector(topic string) (*leakybucket.Collector, error) {
+func (l *limiter) topicCollector(topic string) (*scoredCollector, error) {
 	l.RLock()
 	defer l.RUnlock()
 	return l.retrieveCollector(topic)
 }
 
-// validates a request with the accompanying cost.
+// validates a request with the accompanying cost, measured as a request
+// count only; validateSizedRequest also checks a parallel byte budget.
 func (l *limiter) validateRequest(stream network.Stream, amt uint64) error {
+	return l.validateSizedRequest(stream, amt, 0)
+}
+
+// validateSizedRequest is validateRequest plus a request size in bytes,
+// used by RPCs whose cost should scale with payload size rather than a
+// flat per-call amount.
+func (l *limiter) validateSizedRequest(stream network.Stream, amt uint64, sizeBytes uint64) error {
 	l.RLock()
 	defer l.RUnlock()
 
@@ -72,16 +106,16 @@ func (l *limiter) validateRequest(stream network.Stream, amt uint64) error {
 	if err != nil {
 		return err
 	}
-	key := stream.Conn().RemotePeer().String()
-	remaining := collector.Remaining(key)
+	pid := stream.Conn().RemotePeer()
 	// Treat each request as a minimum of 1.
 	if amt == 0 {
 		amt = 1
 	}
-	if amt > uint64(remaining) {
-		l.p2p.Peers().Scorers().BadResponsesScorer().Increment(stream.Conn().RemotePeer())
-		writeErrorResponseToStream(responseCodeInvalidRequest, p2ptypes.ErrRateLimited.Error(), stream, l.p2p)
-		return p2ptypes.ErrRateLimited
+	if amt > uint64(collector.remaining(pid)) || (sizeBytes > 0 && sizeBytes > uint64(collector.remainingBytes(pid))) {
+		l.p2p.Peers().Scorers().BadResponsesScorer().Increment(pid)
+		rlErr := &RateLimitError{Topic: topic, RetryAfter: retryAfterWindow}
+		writeErrorResponseToStream(responseCodeInvalidRequest, rlErr.Error(), stream, l.p2p)
+		return rlErr
 	}
 	return nil
 }
@@ -97,20 +131,24 @@ func (l *limiter) validateRawRpcRequest(stream network.Stream) error {
 	if err != nil {
 		return err
 	}
-	key := stream.Conn().RemotePeer().String()
-	remaining := collector.Remaining(key)
-	// Treat each request as a minimum of 1.
-	amt := int64(1)
-	if amt > remaining {
-		l.p2p.Peers().Scorers().BadResponsesScorer().Increment(stream.Conn().RemotePeer())
-		writeErrorResponseToStream(responseCodeInvalidRequest, p2ptypes.ErrRateLimited.Error(), stream, l.p2p)
-		return p2ptypes.ErrRateLimited
+	pid := stream.Conn().RemotePeer()
+	if collector.remaining(pid) < 1 {
+		l.p2p.Peers().Scorers().BadResponsesScorer().Increment(pid)
+		rlErr := &RateLimitError{Topic: topic, RetryAfter: retryAfterWindow}
+		writeErrorResponseToStream(responseCodeInvalidRequest, rlErr.Error(), stream, l.p2p)
+		return rlErr
 	}
 	return nil
 }
 
 // adds the cost to our leaky bucket for the topic.
 func (l *limiter) add(stream network.Stream, amt int64) {
+	l.addSized(stream, amt, 0)
+}
+
+// addSized is add plus a request size in bytes to debit from the topic's
+// byte sub-bucket.
+func (l *limiter) addSized(stream network.Stream, amt int64, sizeBytes int64) {
 	l.Lock()
 	defer l.Unlock()
 
@@ -122,8 +160,7 @@ func (l *limiter) add(stream network.Stream, amt int64) {
 		log.Errorf("collector with topic '%s' does not exist", topic)
 		return
 	}
-	key := stream.Conn().RemotePeer().String()
-	collector.Add(key, amt)
+	collector.add(stream.Conn().RemotePeer(), amt, sizeBytes)
 }
 
 // adds the cost to our leaky bucket for the peer.
@@ -139,8 +176,7 @@ func (l *limiter) addRawStream(stream network.Stream) {
 		log.Errorf("collector with topic '%s' does not exist", topic)
 		return
 	}
-	key := stream.Conn().RemotePeer().String()
-	collector.Add(key, 1)
+	collector.add(stream.Conn().RemotePeer(), 1, 0)
 }
 
 // frees all the collectors and removes them.
@@ -158,7 +194,7 @@ func (l *limiter) free() {
 			delete(l.limiterMap, t)
 			continue
 		}
-		collector.Free()
+		collector.free()
 		// Remove from map
 		delete(l.limiterMap, t)
 		tempMap[ptr] = true
@@ -167,7 +203,7 @@ func (l *limiter) free() {
 
 // not to be used outside the rate limiter file as it is unsafe for concurrent usage
 // and is protected by a lock on all of its usages here.
-func (l *limiter) retrieveCollector(topic string) (*leakybucket.Collector, error) {
+func (l *limiter) retrieveCollector(topic string) (*scoredCollector, error) {
 	if !mutexasserts.RWMutexLocked(&l.RWMutex) && !mutexasserts.RWMutexRLocked(&l.RWMutex) {
 		return nil, errors.New("limiter.retrieveCollector: caller must hold read/write lock")
 	}
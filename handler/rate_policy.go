@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/RosettaFlow/Carrier-Go/p2p"
+	"github.com/kevinms/leakybucket-go"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// RatePolicy tunes how a topic's effective per-peer allotment scales with
+// that peer's good/bad response history. Burst is the nominal per-peer
+// burst size before scoring is applied; Alpha controls how strongly the
+// (good - bad) score shifts the effective capacity, clamped to
+// [Min, Max] * Burst.
+type RatePolicy struct {
+	Rate  float64
+	Burst float64
+	Alpha float64
+	Min   float64
+	Max   float64
+}
+
+// DefaultRatePolicy mirrors the behavior of a plain, unscored leaky bucket:
+// no scaling is applied.
+var DefaultRatePolicy = RatePolicy{Rate: 1, Burst: defaultBurstLimit, Alpha: 0, Min: 1, Max: 1}
+
+func clamp(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// reputationScorer is the subset of p2p.Peers().Scorers().BadResponsesScorer()
+// this package consults when sizing a peer's effective rate limit.
+type reputationScorer interface {
+	Score(pid peer.ID) float64
+}
+
+// goodReputationScorer is implemented by an optional GoodResponsesScorer
+// registered alongside the BadResponsesScorer to additionally reward
+// well-behaved peers; nodes whose scorer registry does not expose one
+// simply get Alpha applied to the bad score alone. Its method is
+// deliberately named differently from reputationScorer.Score so the two
+// are never structurally interchangeable.
+type goodReputationScorer interface {
+	GoodScore(pid peer.ID) float64
+}
+
+// goodScorerRegistry is implemented by a p2p scorer registry that also
+// exposes a GoodResponsesScorer; older registries without one simply don't
+// satisfy this interface, which lookupGoodResponsesScorer treats as "none
+// registered" rather than a fatal error.
+type goodScorerRegistry interface {
+	GoodResponsesScorer() goodReputationScorer
+}
+
+// lookupGoodResponsesScorer returns p2pProvider's GoodResponsesScorer, or
+// nil if its scorer registry doesn't expose one.
+func lookupGoodResponsesScorer(p2pProvider p2p.P2P) goodReputationScorer {
+	registry, ok := p2pProvider.Peers().Scorers().(goodScorerRegistry)
+	if !ok {
+		return nil
+	}
+	return registry.GoodResponsesScorer()
+}
+
+// RateLimitError is returned when a request is rejected for exceeding its
+// effective rate limit. Unlike a bare sentinel error it carries a
+// RetryAfter hint so the caller can back off instead of retrying
+// immediately (and getting penalized again).
+type RateLimitError struct {
+	Topic      string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited on topic %q, retry after %s", e.Topic, e.RetryAfter)
+}
+
+// scoredCollector wraps a leakybucket.Collector for one topic, recomputing
+// each peer's effective capacity from its reputation on every access
+// rather than maintaining a separate bucket per score tier. It also tracks
+// a parallel byte-denominated bucket so large requests (e.g.
+// BlocksByRange) drain proportionally more of the budget than their
+// request count alone would imply.
+type scoredCollector struct {
+	mu sync.RWMutex
+
+	topic  string
+	policy RatePolicy
+	counts *leakybucket.Collector
+	bytes  *leakybucket.Collector
+	bad    reputationScorer
+	good   goodReputationScorer // nil if the node has no GoodResponsesScorer registered.
+}
+
+func newScoredCollector(topic string, policy RatePolicy, bad reputationScorer, good goodReputationScorer) *scoredCollector {
+	capacity := bucketCapacity(policy)
+	return &scoredCollector{
+		topic:  topic,
+		policy: policy,
+		counts: leakybucket.NewCollector(policy.Rate, int64(capacity), false /* deleteEmptyBuckets */),
+		bytes:  leakybucket.NewCollector(policy.Rate*defaultBytesPerUnit, int64(capacity*defaultBytesPerUnit), false /* deleteEmptyBuckets */),
+		bad:    bad,
+		good:   good,
+	}
+}
+
+// defaultBytesPerUnit is the assumed average request size (bytes) used to
+// derive the byte sub-bucket's burst and leak rate from the count burst and
+// rate.
+const defaultBytesPerUnit = 4096
+
+// bucketCapacity sizes the underlying leaky bucket by Burst*Max rather than
+// the nominal Burst alone, so a well-scored peer (effective factor > 1) has
+// actual headroom to draw on instead of the bucket itself capping every
+// peer at the nominal burst regardless of reputation.
+func bucketCapacity(policy RatePolicy) float64 {
+	return policy.Burst * policy.Max
+}
+
+func (c *scoredCollector) setPolicy(policy RatePolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.policy = policy
+	c.counts.Free()
+	c.bytes.Free()
+	capacity := bucketCapacity(policy)
+	c.counts = leakybucket.NewCollector(policy.Rate, int64(capacity), false)
+	c.bytes = leakybucket.NewCollector(policy.Rate*defaultBytesPerUnit, int64(capacity*defaultBytesPerUnit), false)
+}
+
+// effectiveFactor computes clamp(1 + alpha*(good-bad), min, max) for pid.
+func (c *scoredCollector) effectiveFactor(pid peer.ID) float64 {
+	c.mu.RLock()
+	policy := c.policy
+	c.mu.RUnlock()
+
+	badScore := c.bad.Score(pid)
+	var goodScore float64
+	if c.good != nil {
+		goodScore = c.good.GoodScore(pid)
+	}
+	return clamp(1+policy.Alpha*(goodScore-badScore), policy.Min, policy.Max)
+}
+
+// remaining returns the peer's remaining count budget: the lesser of what
+// the bucket (sized by Burst*Max) actually has left and Burst*factor, the
+// nominal burst scaled by the peer's reputation. Since the bucket can hold
+// more than the nominal burst, this never floors a peer with tokens left
+// and a small positive factor down to a hard 0 the way truncating
+// base*factor directly would.
+func (c *scoredCollector) remaining(pid peer.ID) int64 {
+	c.mu.RLock()
+	burst := c.policy.Burst
+	c.mu.RUnlock()
+	factor := c.effectiveFactor(pid)
+	return effectiveRemaining(c.counts.Remaining(pid.String()), burst*factor)
+}
+
+// remainingBytes is remaining's counterpart for the byte sub-bucket.
+func (c *scoredCollector) remainingBytes(pid peer.ID) int64 {
+	c.mu.RLock()
+	burst := c.policy.Burst
+	c.mu.RUnlock()
+	factor := c.effectiveFactor(pid)
+	return effectiveRemaining(c.bytes.Remaining(pid.String()), burst*factor*defaultBytesPerUnit)
+}
+
+// effectiveRemaining caps base (what the underlying bucket actually has
+// left) at effectiveCap (the reputation-scaled nominal allowance),
+// rounding up so a peer with tokens left and a nonzero cap is never
+// truncated down to 0.
+func effectiveRemaining(base int64, effectiveCap float64) int64 {
+	if base <= 0 {
+		return 0
+	}
+	effCap := int64(math.Ceil(effectiveCap))
+	if effCap < 1 {
+		effCap = 1
+	}
+	if base < effCap {
+		return base
+	}
+	return effCap
+}
+
+func (c *scoredCollector) add(pid peer.ID, amt int64, sizeBytes int64) {
+	c.counts.Add(pid.String(), amt)
+	if sizeBytes > 0 {
+		c.bytes.Add(pid.String(), sizeBytes)
+	}
+}
+
+func (c *scoredCollector) free() {
+	c.counts.Free()
+	c.bytes.Free()
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"github.com/RosettaFlow/Carrier-Go/consensus/bft"
+	coretypes "github.com/RosettaFlow/Carrier-Go/core/types"
+	"github.com/RosettaFlow/Carrier-Go/p2p"
+	"github.com/RosettaFlow/Carrier-Go/types"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/protocol"
+)
+
+// TaskStore returns the current, owned TaskDataArray a by-range sync
+// request should be served from.
+type TaskStore func() types.TaskDataArray
+
+// ResourceStore is TaskStore's counterpart for resources.
+type ResourceStore func() coretypes.ResourceArray
+
+// Service owns the p2p rate limiter and registers every RPC/gossip topic
+// this package knows how to serve against the underlying host, so the
+// collectors and handlers defined alongside it (by-range sync, BFT gossip)
+// actually receive traffic instead of sitting unused.
+type Service struct {
+	p2p       p2p.P2P
+	limiter   *limiter
+	tasks     TaskStore
+	resources ResourceStore
+	bftEngine *bft.Engine
+}
+
+// NewService builds a Service around p2pProvider. tasks/resources supply
+// the current data set served by the by-range sync topics. bftEngine may be
+// nil, in which case the BFT gossip topics are not registered.
+func NewService(p2pProvider p2p.P2P, tasks TaskStore, resources ResourceStore, bftEngine *bft.Engine) *Service {
+	return &Service{
+		p2p:       p2pProvider,
+		limiter:   newRateLimiter(p2pProvider),
+		tasks:     tasks,
+		resources: resources,
+		bftEngine: bftEngine,
+	}
+}
+
+// SetPolicy updates the RatePolicy for an already-registered topic (the
+// encoded form, as used internally, e.g. RPCTasksByRangeTopic plus the
+// host's protocol suffix), letting a config hot-reload retune limits
+// without restarting the service.
+func (s *Service) SetPolicy(topic string, policy RatePolicy) error {
+	return s.limiter.SetPolicy(topic, policy)
+}
+
+// Start registers every topic handler this package provides against the
+// p2p host. It must be called once, after the host is listening.
+func (s *Service) Start() error {
+	s.registerRangeSyncTopics()
+	if s.bftEngine != nil {
+		s.registerBFTTopics()
+	}
+	return nil
+}
+
+// registerRangeSyncTopics wires RPCTasksByRangeTopic/RPCResourcesByRangeTopic
+// onto the host and adds their collectors to the rate limiter, so requests
+// on those topics are both served and rate-limited like every other RPC.
+func (s *Service) registerRangeSyncTopics() {
+	addEncoding := func(topic string) string {
+		return topic + s.p2p.Encoding().ProtocolSuffix()
+	}
+
+	bad := s.p2p.Peers().Scorers().BadResponsesScorer()
+	good := lookupGoodResponsesScorer(s.p2p)
+
+	tasksTopic := addEncoding(RPCTasksByRangeTopic)
+	resourcesTopic := addEncoding(RPCResourcesByRangeTopic)
+
+	s.limiter.Lock()
+	s.limiter.limiterMap[tasksTopic] = newScoredCollector(tasksTopic, rangeSyncPolicy, bad, good)
+	s.limiter.limiterMap[resourcesTopic] = newScoredCollector(resourcesTopic, rangeSyncPolicy, bad, good)
+	s.limiter.Unlock()
+
+	s.p2p.Host().SetStreamHandler(protocol.ID(tasksTopic), s.handleTasksByRange)
+	s.p2p.Host().SetStreamHandler(protocol.ID(resourcesTopic), s.handleResourcesByRange)
+}
+
+// rangeSyncPolicy sizes the by-range topics' collectors by the maximum
+// number of frames (and, transitively, bytes) a single request can
+// produce, same as the RPCBlocksByRangeTopic collector it mirrors.
+var rangeSyncPolicy = RatePolicy{Rate: 1, Burst: rangeStreamBurst, Alpha: 1, Min: 0.1, Max: 3}
+
+func (s *Service) handleTasksByRange(stream network.Stream) {
+	defer stream.Close()
+
+	req, err := readRangeRequest(s.p2p, stream)
+	if err != nil {
+		log.Errorf("range sync: failed to read request on %s from %s: %v", RPCTasksByRangeTopic, stream.Conn().RemotePeer(), err)
+		return
+	}
+	resumeToken, err := writeTasksByRange(s.limiter, stream, s.tasks(), req)
+	if err != nil {
+		log.Errorf("range sync: failed to serve %s to %s: %v", RPCTasksByRangeTopic, stream.Conn().RemotePeer(), err)
+		return
+	}
+	if err := writeResumeToken(stream, resumeToken); err != nil {
+		log.Errorf("range sync: failed to write resume token on %s to %s: %v", RPCTasksByRangeTopic, stream.Conn().RemotePeer(), err)
+	}
+}
+
+func (s *Service) handleResourcesByRange(stream network.Stream) {
+	defer stream.Close()
+
+	req, err := readRangeRequest(s.p2p, stream)
+	if err != nil {
+		log.Errorf("range sync: failed to read request on %s from %s: %v", RPCResourcesByRangeTopic, stream.Conn().RemotePeer(), err)
+		return
+	}
+	resumeToken, err := writeResourcesByRange(s.limiter, stream, s.resources(), req)
+	if err != nil {
+		log.Errorf("range sync: failed to serve %s to %s: %v", RPCResourcesByRangeTopic, stream.Conn().RemotePeer(), err)
+		return
+	}
+	if err := writeResumeToken(stream, resumeToken); err != nil {
+		log.Errorf("range sync: failed to write resume token on %s to %s: %v", RPCResourcesByRangeTopic, stream.Conn().RemotePeer(), err)
+	}
+}
+
+// bftVotePolicy sizes the BFT vote/view-change topics' collectors: votes
+// are small and frequent relative to by-range sync, so the burst is modest
+// but the reputation scaling is as aggressive as the other consensus-
+// critical topics.
+var bftVotePolicy = RatePolicy{Rate: 20, Burst: defaultBurstLimit * 4, Alpha: 1, Min: 0.1, Max: 3}
+
+// registerBFTTopics wires BFTPrepareVoteTopic/BFTCommitVoteTopic/
+// BFTViewChangeTopic onto the host and adds their collectors to the rate
+// limiter, so incoming votes actually reach s.bftEngine instead of the
+// handlers sitting unused.
+func (s *Service) registerBFTTopics() {
+	addEncoding := func(topic string) string {
+		return topic + s.p2p.Encoding().ProtocolSuffix()
+	}
+
+	bad := s.p2p.Peers().Scorers().BadResponsesScorer()
+	good := lookupGoodResponsesScorer(s.p2p)
+	h := newBFTGossipHandlers(s.p2p, s.bftEngine)
+
+	register := func(topic string, handle func(network.Stream) error) {
+		full := addEncoding(topic)
+		s.limiter.Lock()
+		s.limiter.limiterMap[full] = newScoredCollector(full, bftVotePolicy, bad, good)
+		s.limiter.Unlock()
+		s.p2p.Host().SetStreamHandler(protocol.ID(full), func(stream network.Stream) {
+			s.handleBFTMessage(topic, handle, stream)
+		})
+	}
+	register(BFTPrepareVoteTopic, h.onPrepareVote)
+	register(BFTCommitVoteTopic, h.onCommitVote)
+	register(BFTViewChangeTopic, h.onViewChange)
+}
+
+func (s *Service) handleBFTMessage(topic string, handle func(network.Stream) error, stream network.Stream) {
+	defer stream.Close()
+
+	if err := s.limiter.validateRequest(stream, 1); err != nil {
+		return
+	}
+	if err := handle(stream); err != nil {
+		log.Errorf("bft: failed to handle %s message from %s: %v", topic, stream.Conn().RemotePeer(), err)
+		return
+	}
+	s.limiter.add(stream, 1)
+}
@@ -0,0 +1,33 @@
+package node
+
+import (
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+// DumpConfigCommand prints the effective merged config (defaults -> file
+// -> env -> flags) as TOML, so operators can seed a config file from their
+// current flag set instead of hand-writing one.
+var DumpConfigCommand = &cli.Command{
+	Action:    dumpConfig,
+	Name:      "dumpconfig",
+	Usage:     "Show configuration values",
+	ArgsUsage: "",
+	Description: `The dumpconfig command shows configuration values.`,
+}
+
+func dumpConfig(ctx *cli.Context) error {
+	cfg := makeConfig(ctx)
+
+	out := os.Stdout
+	if ctx.Args().Len() > 0 {
+		f, err := os.OpenFile(ctx.Args().Get(0), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	return dumpConfigFile(cfg, out)
+}
@@ -0,0 +1,11 @@
+package node
+
+import "github.com/urfave/cli/v2"
+
+// Commands are this package's subcommands, collected here so a main
+// package can register them with a single `app.Commands =
+// append(app.Commands, node.Commands...)` instead of reaching into each
+// file that defines one.
+var Commands = []*cli.Command{
+	DumpConfigCommand,
+}
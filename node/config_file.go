@@ -0,0 +1,149 @@
+package node
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/naoina/toml"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+var log = logrus.WithField("module", "node")
+
+// envPrefix namespaces every environment variable this loader consults so
+// it can't collide with unrelated CARRIER_* usage outside config loading.
+const envPrefix = "CARRIER_"
+
+var tomlSettings = toml.Config{
+	NormFieldName: func(rt reflect.Type, key string) string { return key },
+	FieldToKey:    func(rt reflect.Type, field string) string { return field },
+	MissingField: func(rt reflect.Type, field string) error {
+		link := ""
+		if unicodeIsUpper(rt.Name()) {
+			link = fmt.Sprintf(", see https://godoc.org/%s#%s for available fields", rt.PkgPath(), rt.Name())
+		}
+		return errors.Errorf("field '%s' is not defined in %s%s", field, rt.String(), link)
+	},
+}
+
+func unicodeIsUpper(s string) bool {
+	return s != "" && s[0] >= 'A' && s[0] <= 'Z'
+}
+
+// loadConfigFile reads file (TOML by default, YAML if its extension is
+// .yml/.yaml) into cfg. Fields absent from the file retain whatever
+// default they already had.
+func loadConfigFile(file string, cfg *carrierConfig) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yml", ".yaml":
+		dec := yaml.NewDecoder(bufio.NewReader(f))
+		return dec.Decode(cfg)
+	default:
+		err := tomlSettings.NewDecoder(bufio.NewReader(f)).Decode(cfg)
+		// Add file name to errors that have a line number.
+		if _, ok := err.(*toml.LineError); ok {
+			err = errors.New(file + ", " + err.Error())
+		}
+		return err
+	}
+}
+
+// dumpConfigFile marshals cfg as TOML to w, the format a user can copy
+// into a new config file to persist their current flag set.
+func dumpConfigFile(cfg carrierConfig, w *os.File) error {
+	out, err := tomlSettings.Marshal(&cfg)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// applyEnvOverrides walks cfg's field names via reflection and, for every
+// leaf field, checks whether CARRIER_<PATH> is set in the environment; if
+// so it overrides the field's current (default- or file-derived) value.
+// PATH is the field's path joined with underscores, e.g. CARRIER_NODE_NAME
+// for cfg.Node.Name.
+func applyEnvOverrides(cfg *carrierConfig) {
+	applyEnvOverridesRec(reflect.ValueOf(cfg).Elem(), envPrefix)
+}
+
+func applyEnvOverridesRec(v reflect.Value, prefix string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported field
+			continue
+		}
+		fv := v.Field(i)
+		key := prefix + strings.ToUpper(field.Name)
+
+		switch fv.Kind() {
+		case reflect.Struct:
+			applyEnvOverridesRec(fv, key+"_")
+			continue
+		case reflect.Ptr:
+			if fv.IsNil() {
+				continue
+			}
+			applyEnvOverridesRec(fv.Elem(), key+"_")
+			continue
+		}
+
+		raw, ok := os.LookupEnv(key)
+		if !ok || !fv.CanSet() {
+			continue
+		}
+		if err := setFromString(fv, raw); err != nil {
+			log.Warnf("ignoring %s: %v", key, err)
+		}
+	}
+}
+
+func setFromString(fv reflect.Value, raw string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return errors.Errorf("unsupported field kind %s for env override", fv.Kind())
+	}
+	return nil
+}
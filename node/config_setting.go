@@ -11,20 +11,35 @@ const (
 )
 
 type carrierConfig struct {
-	Carrier   carrier.Config
-	Node      Config
+	Carrier carrier.Config
+	Node    Config
+
+	// RateLimits overrides, by registered topic, the default RatePolicy a
+	// handler.Service's rate limiter applies; entries are hot-reloadable
+	// via ConfigWatcher, so operators can retune limits without a
+	// restart. A topic absent here keeps whatever policy the service
+	// registered it with.
+	RateLimits map[string]RateLimitPolicy
 }
 
 func makeConfig(ctx *cli.Context) carrierConfig {
 	// Load defaults.
 	cfg := carrierConfig{
-		Carrier:   carrier.DefaultConfig,
-		Node:      defaultNodeConfig(),
+		Carrier: carrier.DefaultConfig,
+		Node:    defaultNodeConfig(),
+	}
+
+	// Load config file, if one was given on the command line.
+	if file := ctx.String(flags.ConfigFileFlag.Name); file != "" {
+		if err := loadConfigFile(file, &cfg); err != nil {
+			log.Fatalf("failed to load config file %q: %v", file, err)
+		}
 	}
-	// Load config file.
-	// todo: file conf load for config.
 
-	// Apply flags.
+	// Layer environment variables (CARRIER_*) on top of file/defaults.
+	applyEnvOverrides(&cfg)
+
+	// Apply flags; these always take precedence over file and env.
 	flags.SetNodeConfig(ctx, &cfg.Node)
 	flags.SetCarrierConfig(ctx, &cfg.Carrier)
 	return cfg
@@ -33,4 +48,4 @@ func makeConfig(ctx *cli.Context) carrierConfig {
 func defaultNodeConfig() Config {
 	cfg := DefaultConfig
 	return cfg
-}
\ No newline at end of file
+}
@@ -0,0 +1,144 @@
+package node
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/RosettaFlow/Carrier-Go/handler"
+	"github.com/fsnotify/fsnotify"
+)
+
+// OnConfigChange is implemented by subsystems that can safely re-read
+// their configuration while running, e.g. rate-limiter policies or peer
+// scorer thresholds. Returning an error rejects the reload: the watcher
+// keeps the previous config as current and calls no further callbacks.
+// Changes already applied by earlier callbacks, or by the failing one
+// before it returned, are not undone.
+type OnConfigChange func(old, new carrierConfig) error
+
+// ConfigWatcher watches a config file on disk and, on change, reloads it,
+// diffs it against the previously-applied config, and notifies registered
+// callbacks so long-running subsystems can pick up the new values without
+// a restart.
+type ConfigWatcher struct {
+	mu        sync.Mutex
+	path      string
+	current   carrierConfig
+	watcher   *fsnotify.Watcher
+	callbacks []OnConfigChange
+
+	done chan struct{}
+}
+
+// NewConfigWatcher starts watching path (the file previously loaded into
+// initial by loadConfigFile) for changes.
+func NewConfigWatcher(path string, initial carrierConfig) (*ConfigWatcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Add(path); err != nil {
+		w.Close()
+		return nil, err
+	}
+	cw := &ConfigWatcher{
+		path:    path,
+		current: initial,
+		watcher: w,
+		done:    make(chan struct{}),
+	}
+	go cw.loop()
+	return cw, nil
+}
+
+// StartConfigWatcher opens path for watching, applies initial.RateLimits to
+// svc's rate limiter and registers it to pick up RateLimits changes from
+// the file, so the config file a node was started with keeps governing its
+// rate limits for the lifetime of the process instead of only at startup.
+// Callers that need additional hot-reloadable subsystems can Register more
+// callbacks on the returned watcher.
+func StartConfigWatcher(path string, initial carrierConfig, svc *handler.Service) (*ConfigWatcher, error) {
+	cw, err := NewConfigWatcher(path, initial)
+	if err != nil {
+		return nil, err
+	}
+	if svc != nil {
+		apply := RateLimitOnConfigChange(svc)
+		if err := apply(carrierConfig{}, initial); err != nil {
+			cw.Close()
+			return nil, err
+		}
+		cw.Register(apply)
+	}
+	return cw, nil
+}
+
+// Register adds a callback to be invoked whenever the watched file
+// changes. Callbacks run in registration order; the first one to return
+// an error stops the reload, and later callbacks are not called. What
+// earlier callbacks already applied is not rolled back.
+func (cw *ConfigWatcher) Register(cb OnConfigChange) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	cw.callbacks = append(cw.callbacks, cb)
+}
+
+// Close stops the watcher.
+func (cw *ConfigWatcher) Close() error {
+	close(cw.done)
+	return cw.watcher.Close()
+}
+
+func (cw *ConfigWatcher) loop() {
+	for {
+		select {
+		case <-cw.done:
+			return
+		case ev, ok := <-cw.watcher.Events:
+			if !ok {
+				return
+			}
+			if ev.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			cw.reload()
+		case err, ok := <-cw.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Errorf("config watcher: %v", err)
+		}
+	}
+}
+
+func (cw *ConfigWatcher) reload() {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	updated := cw.current
+	// Decode into a copy of RateLimits so loading the file cannot mutate
+	// the map cw.current still holds, which would hide the change.
+	if cw.current.RateLimits != nil {
+		updated.RateLimits = make(map[string]RateLimitPolicy, len(cw.current.RateLimits))
+		for topic, policy := range cw.current.RateLimits {
+			updated.RateLimits[topic] = policy
+		}
+	}
+	if err := loadConfigFile(cw.path, &updated); err != nil {
+		log.Errorf("config watcher: failed to reload %q, keeping previous config: %v", cw.path, err)
+		return
+	}
+	if reflect.DeepEqual(updated, cw.current) {
+		return
+	}
+
+	old := cw.current
+	for _, cb := range cw.callbacks {
+		if err := cb(old, updated); err != nil {
+			log.Errorf("config watcher: rejecting reload of %q, subsystem cannot apply it: %v", cw.path, err)
+			return
+		}
+	}
+	cw.current = updated
+	log.Infof("config watcher: applied updated config from %q", cw.path)
+}
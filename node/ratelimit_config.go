@@ -0,0 +1,37 @@
+package node
+
+import "github.com/RosettaFlow/Carrier-Go/handler"
+
+// RateLimitPolicy mirrors handler.RatePolicy in a config-file-friendly
+// shape, so per-topic rate limits can be set in the config file and picked
+// up by ConfigWatcher. They cannot be set from environment variables or
+// flags.
+type RateLimitPolicy struct {
+	Rate  float64
+	Burst float64
+	Alpha float64
+	Min   float64
+	Max   float64
+}
+
+func (p RateLimitPolicy) toHandlerPolicy() handler.RatePolicy {
+	return handler.RatePolicy{Rate: p.Rate, Burst: p.Burst, Alpha: p.Alpha, Min: p.Min, Max: p.Max}
+}
+
+// RateLimitOnConfigChange returns an OnConfigChange callback that applies
+// every changed entry of new.RateLimits to svc via SetPolicy, so a config
+// reload actually retunes the running rate limiter instead of only
+// updating in-memory config that nothing reads again.
+func RateLimitOnConfigChange(svc *handler.Service) OnConfigChange {
+	return func(old, new carrierConfig) error {
+		for topic, policy := range new.RateLimits {
+			if oldPolicy, ok := old.RateLimits[topic]; ok && oldPolicy == policy {
+				continue
+			}
+			if err := svc.SetPolicy(topic, policy.toHandlerPolicy()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
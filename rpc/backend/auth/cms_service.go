@@ -1,28 +1,86 @@
 package auth
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	pb "github.com/RosettaFlow/Carrier-Go/lib/api"
 	"github.com/RosettaFlow/Carrier-Go/rpc/backend"
 	"github.com/RosettaFlow/Carrier-Go/types"
 	"time"
 )
 
+// identityChallengeTTL bounds how long a nonce returned by
+// RequestIdentityChallenge remains valid for a subsequent ApplyIdentityJoin.
+const identityChallengeTTL = 5 * time.Minute
+
+func (svr *AuthServiceServer) RequestIdentityChallenge(ctx context.Context, req *pb.RequestIdentityChallengeRequest) (*pb.RequestIdentityChallengeResponse, error) {
+	if req.NodeId == "" || req.IdentityId == "" {
+		return &pb.RequestIdentityChallengeResponse{
+			Status: 0,
+			Msg:    "Invalid Params",
+		}, nil
+	}
+	challenge, err := svr.B.IssueIdentityChallenge(req.NodeId, req.IdentityId, identityChallengeTTL)
+	if nil != err {
+		return nil, backend.NewRpcBizErr(ErrRequestIdentityChallengeStr)
+	}
+	return &pb.RequestIdentityChallengeResponse{
+		Status:   0,
+		Msg:      backend.OK,
+		Nonce:    challenge.Nonce,
+		ExpireAt: challenge.ExpireAt,
+	}, nil
+}
+
 func (svr *AuthServiceServer) ApplyIdentityJoin(ctx context.Context, req *pb.ApplyIdentityJoinRequest) (*pb.SimpleResponseCode, error) {
-	identityMsg := new(types.IdentityMsg)
-	if req.Member == nil {
+	if req.Member == nil || req.Member.Proof == nil {
 		return &pb.SimpleResponseCode{
 			Status: 0,
 			Msg:    "Invalid Params",
 		}, nil
 	}
+
+	// CreateAt is part of what the caller signed, so it must come from the
+	// request, not the server's clock: the client cannot predict the
+	// server's wall-clock nanosecond at verification time.
+	createAt := req.Member.CreateAt
+	payload := identityProofPayload(req.Member.Proof.Nonce, req.Member.NodeId, req.Member.IdentityId, createAt)
+
+	// Look up the challenge without burning it yet: a rejected signature
+	// must leave the nonce usable for a legitimate retry.
+	challenge, err := svr.B.GetIdentityChallenge(req.Member.NodeId, req.Member.IdentityId, req.Member.Proof.Nonce)
+	if nil != err {
+		return nil, backend.NewRpcBizErr(ErrIdentityChallengeExpiredStr)
+	}
+	if challenge.ExpireAt < uint64(time.Now().Unix()) {
+		return nil, backend.NewRpcBizErr(ErrIdentityChallengeExpiredStr)
+	}
+	if !svr.B.VerifyNodeSignature(req.Member.NodeId, payload, req.Member.Proof.NodeSig) {
+		return nil, backend.NewRpcBizErr(ErrInvalidIdentityProofStr)
+	}
+	if len(req.Member.Proof.IdentitySig) > 0 && !svr.B.VerifyIdentitySignature(req.Member.IdentityId, payload, req.Member.Proof.IdentitySig) {
+		return nil, backend.NewRpcBizErr(ErrInvalidIdentityProofStr)
+	}
+
+	// Only burn the nonce once the proof has actually been accepted.
+	if err := svr.B.ConsumeIdentityChallenge(req.Member.NodeId, req.Member.IdentityId, req.Member.Proof.Nonce); nil != err {
+		return nil, backend.NewRpcBizErr(ErrIdentityChallengeExpiredStr)
+	}
+
+	identityMsg := new(types.IdentityMsg)
 	identityMsg.NodeAlias = &types.NodeAlias{}
 	identityMsg.Name = req.Member.Name
 	identityMsg.IdentityId = req.Member.IdentityId
 	identityMsg.NodeId = req.Member.NodeId
-	identityMsg.CreateAt = uint64(time.Now().UnixNano())
+	identityMsg.CreateAt = createAt
+	identityMsg.Proof = &types.IdentityProof{
+		Nonce:       req.Member.Proof.Nonce,
+		NodeSig:     req.Member.Proof.NodeSig,
+		IdentitySig: req.Member.Proof.IdentitySig,
+	}
 
-	err := svr.B.SendMsg(identityMsg)
+	err = svr.B.SendMsg(identityMsg)
 	if nil != err {
 		return nil, backend.NewRpcBizErr(ErrSendIdentityMsgStr)
 	}
@@ -32,10 +90,49 @@ func (svr *AuthServiceServer) ApplyIdentityJoin(ctx context.Context, req *pb.App
 	}, nil
 }
 
-func (svr *AuthServiceServer) RevokeIdentityJoin(ctx context.Context, req *pb.EmptyGetParams) (*pb.SimpleResponseCode, error) {
+func (svr *AuthServiceServer) RevokeIdentityJoin(ctx context.Context, req *pb.RevokeIdentityJoinRequest) (*pb.SimpleResponseCode, error) {
+	if req.Proof == nil {
+		return &pb.SimpleResponseCode{
+			Status: 0,
+			Msg:    "Invalid Params",
+		}, nil
+	}
+
+	// As with ApplyIdentityJoin, CreateAt must be the value the caller
+	// actually signed, not a freshly-generated server timestamp.
+	createAt := req.CreateAt
+	payload := identityRevokePayload(req.Proof.Nonce, req.NodeId, req.IdentityId, createAt)
+
+	// Bind the revocation to an issued, unexpired, single-use challenge the
+	// same way ApplyIdentityJoin does: look it up without burning it yet,
+	// so a rejected signature leaves the nonce usable for a legitimate
+	// retry, and only consume it once the proof has actually been
+	// accepted. Without this, a captured valid revoke message could be
+	// replayed indefinitely.
+	challenge, err := svr.B.GetIdentityChallenge(req.NodeId, req.IdentityId, req.Proof.Nonce)
+	if nil != err {
+		return nil, backend.NewRpcBizErr(ErrIdentityChallengeExpiredStr)
+	}
+	if challenge.ExpireAt < uint64(time.Now().Unix()) {
+		return nil, backend.NewRpcBizErr(ErrIdentityChallengeExpiredStr)
+	}
+	if !svr.B.VerifyNodeSignature(req.NodeId, payload, req.Proof.NodeSig) {
+		return nil, backend.NewRpcBizErr(ErrInvalidRevokeProofStr)
+	}
+	if err := svr.B.ConsumeIdentityChallenge(req.NodeId, req.IdentityId, req.Proof.Nonce); nil != err {
+		return nil, backend.NewRpcBizErr(ErrIdentityChallengeExpiredStr)
+	}
+
 	identityRevokeMsg := new(types.IdentityRevokeMsg)
-	identityRevokeMsg.CreateAt = uint64(time.Now().UnixNano())
-	err := svr.B.SendMsg(identityRevokeMsg)
+	identityRevokeMsg.NodeId = req.NodeId
+	identityRevokeMsg.IdentityId = req.IdentityId
+	identityRevokeMsg.CreateAt = createAt
+	identityRevokeMsg.Proof = &types.IdentityRevokeProof{
+		Nonce:   req.Proof.Nonce,
+		NodeSig: req.Proof.NodeSig,
+	}
+
+	err = svr.B.SendMsg(identityRevokeMsg)
 	if nil != err {
 		return nil, backend.NewRpcBizErr(ErrSendIdentityMsgStr)
 	}
@@ -80,4 +177,21 @@ func (svr *AuthServiceServer) GetIdentityList(ctx context.Context, req *pb.Empty
 		Msg:        backend.OK,
 		MemberList: arr,
 	}, nil
-}
\ No newline at end of file
+}
+
+// identityProofPayload is the byte sequence a join request's NodeSig and
+// IdentitySig must cover: nonce || NodeId || IdentityId || CreateAt.
+func identityProofPayload(nonce, nodeId, identityId string, createAt uint64) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString(nonce)
+	buf.WriteString(nodeId)
+	buf.WriteString(identityId)
+	binary.Write(buf, binary.BigEndian, createAt)
+	return buf.Bytes()
+}
+
+// identityRevokePayload is the byte sequence a revocation's NodeSig must
+// cover: nonce || NodeId || IdentityId || CreateAt.
+func identityRevokePayload(nonce, nodeId, identityId string, createAt uint64) []byte {
+	return identityProofPayload(nonce, nodeId, identityId, createAt)
+}
@@ -0,0 +1,11 @@
+package auth
+
+// Error strings for the identity challenge/proof flow. These follow the
+// ErrXxxStr + backend.NewRpcBizErr(...) convention used by the rest of
+// this service.
+const (
+	ErrRequestIdentityChallengeStr = "request identity challenge failed"
+	ErrInvalidIdentityProofStr     = "invalid identity proof"
+	ErrIdentityChallengeExpiredStr = "identity challenge expired or unknown"
+	ErrInvalidRevokeProofStr       = "invalid identity revoke proof"
+)
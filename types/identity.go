@@ -0,0 +1,50 @@
+package types
+
+// IdentityChallenge is a random, short-lived nonce issued by
+// RequestIdentityChallenge and bound to the (NodeId, IdentityId) pair that
+// requested it; ApplyIdentityJoin only accepts a join whose Proof covers
+// the nonce from a challenge that has not yet expired.
+type IdentityChallenge struct {
+	Nonce      string `json:"nonce"`
+	NodeId     string `json:"nodeId"`
+	IdentityId string `json:"identityId"`
+	ExpireAt   uint64 `json:"expireAt"`
+}
+
+// IdentityProof carries the signatures an organization must present to
+// prove it controls both the libp2p host key for NodeId and, optionally,
+// the on-chain identity key for IdentityId. Both signatures cover the same
+// payload: Nonce || NodeId || IdentityId || CreateAt.
+type IdentityProof struct {
+	Nonce string `json:"nonce"`
+	// NodeSig is a signature over the payload by the node's libp2p host key.
+	NodeSig []byte `json:"nodeSig"`
+	// IdentitySig is an optional signature over the payload by the
+	// organization's on-chain (secp256k1) identity key.
+	IdentitySig []byte `json:"identitySig,omitempty"`
+}
+
+// IdentityMsg is broadcast once a join request has been authenticated,
+// carrying the accepted Proof. GetIdentityList returns only each member's
+// Name, NodeId and IdentityId; it does not return the Proof.
+type IdentityMsg struct {
+	*NodeAlias
+	CreateAt uint64         `json:"createAt"`
+	Proof    *IdentityProof `json:"proof"`
+}
+
+// IdentityRevokeProof authenticates a revocation statement so a member
+// cannot be kicked off the network by an unauthenticated caller.
+type IdentityRevokeProof struct {
+	Nonce   string `json:"nonce"`
+	NodeSig []byte `json:"nodeSig"`
+}
+
+// IdentityRevokeMsg is broadcast once a revocation request has been
+// authenticated.
+type IdentityRevokeMsg struct {
+	NodeId     string               `json:"nodeId"`
+	IdentityId string               `json:"identityId"`
+	CreateAt   uint64               `json:"createAt"`
+	Proof      *IdentityRevokeProof `json:"proof"`
+}
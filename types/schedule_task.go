@@ -53,14 +53,41 @@ type TaskConsStatus uint16
 const (
 	TaskConsensusInterrupt TaskConsStatus = 0x0001
 	TaskRunningInterrupt   TaskConsStatus = 0x0100
+
+	// PhasePrepare is set while the coordinator is collecting PrepareVotes.
+	PhasePrepare TaskConsStatus = 0x1000
+	// PhaseCommit is set while the coordinator is collecting CommitVotes.
+	PhaseCommit TaskConsStatus = 0x2000
+	// PhaseViewChange is set when the current view failed to reach quorum
+	// before its timeout and a new view is being negotiated.
+	PhaseViewChange TaskConsStatus = 0x4000
 )
 
+// ConsVote is one participant's signed endorsement of a proposal digest for
+// a given phase, keyed by its identity (libp2p host key derived) NodeId.
+type ConsVote struct {
+	NodeId    string
+	Digest    common.Hash
+	Signature []byte
+}
+
 // Task consensus result
 type TaskConsResult struct {
 	TaskId string
 	Status TaskConsStatus
 	Done   bool
 	Err    error
+
+	// View is the consensus round this result was produced in; it is
+	// bumped on every ViewChange.
+	View uint64
+	// Votes holds the aggregated set of CommitVotes that reached quorum,
+	// or the votes collected so far when Done is false.
+	Votes []*ConsVote
+	// Dissenters lists the NodeIds of participants that sent a ViewChange
+	// in the final view; participants that simply did not vote are not
+	// listed.
+	Dissenters []string
 }
 
 type TaskSchedStatus bool
@@ -5,16 +5,33 @@ import (
 	"github.com/RosettaFlow/Carrier-Go/common"
 	pb "github.com/RosettaFlow/Carrier-Go/lib/api"
 	libTypes "github.com/RosettaFlow/Carrier-Go/lib/types"
+	"hash/crc32"
 	"io"
+	"sync"
 	"sync/atomic"
 )
 
+// taskCrcTable is the CRC-32C (Castagnoli) polynomial table used to
+// cheaply detect corruption in cached-and-replayed Task blobs without
+// having to re-unmarshal them.
+var taskCrcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// taskBufPool recycles the byte slices Hash passes to MarshalTo so hashing
+// a TaskDataArray doesn't allocate a buffer on every call.
+var taskBufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 256)
+		return &buf
+	},
+}
+
 type Task struct {
 	data *libTypes.TaskData
 
 	// caches
 	hash atomic.Value
 	size atomic.Value
+	crc  atomic.Value
 }
 
 func NewTask(data *libTypes.TaskData) *Task {
@@ -32,8 +49,33 @@ func (m *Task) EncodePb(w io.Writer) error {
 	return err
 }
 
+// MarshalTo is a zero-copy-friendly fast path for EncodePb: it marshals
+// into buf, reusing its backing array when it is large enough, instead of
+// allocating a fresh buffer on every call. Like EncodePb, it defers to the
+// generated gogoproto code, which encodes scalar/message fields in a
+// fixed, field-number order with standard (minimal-length) varints; it
+// does not use fixed-width varints, and it is NOT guaranteed
+// deterministic for any field of map type TaskData may gain in the
+// future, since Go randomizes map iteration order. Hash() and Verify()
+// are only as stable as this encoding is.
+func (m *Task) MarshalTo(buf []byte) ([]byte, error) {
+	if m.data == nil {
+		m.data = new(libTypes.TaskData)
+	}
+	size := m.data.Size()
+	if cap(buf) < size {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+	if _, err := m.data.MarshalTo(buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
 func (m *Task) DecodePb(data []byte) error {
 	m.size.Store(common.StorageSize(len(data)))
+	m.crc.Store(crc32.Checksum(data, taskCrcTable))
 	return m.data.Unmarshal(data)
 }
 
@@ -41,13 +83,40 @@ func (m *Task) Hash() common.Hash {
 	if hash := m.hash.Load(); hash != nil {
 		return hash.(common.Hash)
 	}
-	buffer := new(bytes.Buffer)
-	m.EncodePb(buffer)
-	v := protoBufHash(buffer.Bytes())
+
+	bufPtr := taskBufPool.Get().(*[]byte)
+	defer taskBufPool.Put(bufPtr)
+
+	data, err := m.MarshalTo((*bufPtr)[:0])
+	if err != nil {
+		buffer := new(bytes.Buffer)
+		m.EncodePb(buffer)
+		data = buffer.Bytes()
+	} else {
+		// Keep a slice MarshalTo had to grow so the next Hash reuses it.
+		*bufPtr = data[:0]
+	}
+
+	m.size.Store(common.StorageSize(len(data)))
+	m.crc.Store(crc32.Checksum(data, taskCrcTable))
+
+	v := protoBufHash(data)
 	m.hash.Store(v)
 	return v
 }
 
+// Verify reports whether data's CRC-32C matches the checksum cached the
+// last time this Task was hashed or decoded, letting a peer that receives
+// a TaskDataArray.GetPb(i) blob cheaply detect corruption without
+// re-unmarshalling it. It returns false if no checksum has been cached yet.
+func (m *Task) Verify(data []byte) bool {
+	cached := m.crc.Load()
+	if cached == nil {
+		return false
+	}
+	return cached.(uint32) == crc32.Checksum(data, taskCrcTable)
+}
+
 func (m *Task) TaskId() string {
 	return m.data.TaskId
 }
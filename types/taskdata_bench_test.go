@@ -0,0 +1,44 @@
+package types
+
+import (
+	"testing"
+
+	libTypes "github.com/RosettaFlow/Carrier-Go/lib/types"
+)
+
+const benchTaskCount = 10000
+
+func benchTaskMetaData() []*libTypes.TaskData {
+	metaData := make([]*libTypes.TaskData, benchTaskCount)
+	for i := range metaData {
+		metaData[i] = new(libTypes.TaskData)
+	}
+	return metaData
+}
+
+// BenchmarkNewTaskDataArray measures allocations for building an N=10k
+// TaskDataArray from metadata.
+func BenchmarkNewTaskDataArray(b *testing.B) {
+	metaData := benchTaskMetaData()
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = NewTaskDataArray(metaData)
+	}
+}
+
+// BenchmarkTaskDataArray_Hash measures allocations for building a fresh
+// N=10k TaskDataArray and hashing every task in it, exercising the pooled
+// MarshalTo fast path Hash() uses instead of allocating a bytes.Buffer per
+// call.
+func BenchmarkTaskDataArray_Hash(b *testing.B) {
+	metaData := benchTaskMetaData()
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tasks := NewTaskDataArray(metaData)
+		for _, task := range tasks {
+			_ = task.Hash()
+		}
+	}
+}